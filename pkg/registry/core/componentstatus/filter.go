@@ -0,0 +1,193 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	api "k8s.io/kubernetes/pkg/apis/core"
+)
+
+// ComponentStatusFiltersFeatureGate is the feature gate name for the
+// `filter` query parameter. This package neither registers nor checks the
+// gate: the `filter` parameter takes effect only when REST.EnableFilters is
+// true, and setting that field is up to the caller.
+const ComponentStatusFiltersFeatureGate = "ComponentStatusFilters"
+
+// filterTerm is a single `key=value` (optionally `key=!value` to negate)
+// term parsed from a `filter` query parameter.
+type filterTerm struct {
+	key    string
+	value  string
+	negate bool
+}
+
+// parseFilterArgs parses the repeated `filter` query parameter values
+// associated with a component status List request, e.g.
+// ?filter=status=Healthy&filter=name=etcd-*. An item matches only if every
+// parsed term matches (AND semantics); see filterTerm.matches for what each
+// key supports.
+func parseFilterArgs(raw []string) ([]filterTerm, error) {
+	terms := make([]filterTerm, 0, len(raw))
+	for _, entry := range raw {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid filter expression %q: expected key=value", entry)
+		}
+		key, value := parts[0], parts[1]
+
+		switch key {
+		case "name", "status", "error", "message":
+		default:
+			return nil, fmt.Errorf("unsupported filter key %q: must be one of name, status, error, message", key)
+		}
+
+		negate := strings.HasPrefix(value, "!")
+		if negate {
+			value = value[1:]
+		}
+		terms = append(terms, filterTerm{key: key, value: value, negate: negate})
+	}
+	return terms, nil
+}
+
+// matches reports whether status satisfies this term. "name" globs against
+// the component's name; "status" exact-matches the ComponentHealthy
+// condition's Status as one of Healthy, Unhealthy, Unknown; "error" and
+// "message" substring-match the same condition's Error and Message.
+func (t filterTerm) matches(status api.ComponentStatus) bool {
+	var ok bool
+	switch t.key {
+	case "name":
+		matched, err := filepath.Match(t.value, status.Name)
+		ok = err == nil && matched
+	case "status":
+		ok = healthyConditionWord(status) == t.value
+	case "error":
+		c, _ := healthyCondition(status)
+		ok = strings.Contains(c.Error, t.value)
+	case "message":
+		c, _ := healthyCondition(status)
+		ok = strings.Contains(c.Message, t.value)
+	}
+	if t.negate {
+		return !ok
+	}
+	return ok
+}
+
+func matchesFilters(status api.ComponentStatus, terms []filterTerm) bool {
+	for _, t := range terms {
+		if !t.matches(status) {
+			return false
+		}
+	}
+	return true
+}
+
+func healthyCondition(status api.ComponentStatus) (api.ComponentCondition, bool) {
+	for _, c := range status.Conditions {
+		if c.Type == api.ComponentHealthy {
+			return c, true
+		}
+	}
+	return api.ComponentCondition{}, false
+}
+
+func healthyConditionWord(status api.ComponentStatus) string {
+	c, ok := healthyCondition(status)
+	if !ok {
+		return "Unknown"
+	}
+	switch c.Status {
+	case api.ConditionTrue:
+		return "Healthy"
+	case api.ConditionFalse:
+		return "Unhealthy"
+	default:
+		return "Unknown"
+	}
+}
+
+// FilterComponentStatusList applies the `filter` grammar (see
+// parseFilterArgs) to list, returning a new list containing only the
+// matching items.
+func FilterComponentStatusList(list *api.ComponentStatusList, raw []string) (*api.ComponentStatusList, error) {
+	terms, err := parseFilterArgs(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return list, nil
+	}
+
+	filtered := &api.ComponentStatusList{ListMeta: list.ListMeta}
+	for _, status := range list.Items {
+		if matchesFilters(status, terms) {
+			filtered.Items = append(filtered.Items, status)
+		}
+	}
+	return filtered, nil
+}
+
+// filterArgsContextKey is the context key under which the raw `filter`
+// query parameter values for a List request are stashed.
+type filterArgsContextKey struct{}
+
+// WithFilterArgs returns a copy of ctx carrying raw `filter` query
+// parameter values for a subsequent List call. REST.List does not have
+// access to the raw *http.Request (rest.Lister only ever sees ctx and
+// metainternalversion.ListOptions), so WithFilterArgsFromRequest calls this
+// to smuggle the decoded values through ctx; tests that want filter=...
+// behavior without going through an http.Request can also call it directly.
+func WithFilterArgs(ctx context.Context, raw []string) context.Context {
+	return context.WithValue(ctx, filterArgsContextKey{}, raw)
+}
+
+func filterArgsFrom(ctx context.Context) []string {
+	raw, _ := ctx.Value(filterArgsContextKey{}).([]string)
+	return raw
+}
+
+// DecodeFilterQueryParameter extracts the repeated `filter` query
+// parameter values from a request's raw query, e.g.
+// ?filter=status=Healthy&filter=name=etcd-*.
+func DecodeFilterQueryParameter(query url.Values) []string {
+	return query["filter"]
+}
+
+// WithFilterArgsFromRequest is the componentstatus-local decoder for a
+// `GET /api/v1/componentstatuses?filter=...` request: it decodes req's
+// `filter` query parameter values (see DecodeFilterQueryParameter) and, if
+// any are present, attaches them to ctx via WithFilterArgs for REST.List to
+// pick up. Nothing in this package calls it; REST.List sees `filter` values
+// only when its caller has attached them to ctx this way or through
+// WithFilterArgs.
+func WithFilterArgsFromRequest(ctx context.Context, req *http.Request) context.Context {
+	if req == nil || req.URL == nil {
+		return ctx
+	}
+	if raw := DecodeFilterQueryParameter(req.URL.Query()); len(raw) > 0 {
+		return WithFilterArgs(ctx, raw)
+	}
+	return ctx
+}
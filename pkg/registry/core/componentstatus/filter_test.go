@@ -0,0 +1,308 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "k8s.io/kubernetes/pkg/apis/core"
+)
+
+func TestParseFilterArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []string
+		want    []filterTerm
+		wantErr bool
+	}{
+		{
+			name: "single term",
+			raw:  []string{"status=Healthy"},
+			want: []filterTerm{{key: "status", value: "Healthy"}},
+		},
+		{
+			name: "negated term",
+			raw:  []string{"status=!Healthy"},
+			want: []filterTerm{{key: "status", value: "Healthy", negate: true}},
+		},
+		{
+			name: "multiple terms, AND semantics",
+			raw:  []string{"status=Healthy", "name=etcd-*"},
+			want: []filterTerm{
+				{key: "status", value: "Healthy"},
+				{key: "name", value: "etcd-*"},
+			},
+		},
+		{
+			name:    "missing value",
+			raw:     []string{"status"},
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			raw:     []string{"=Healthy"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported key",
+			raw:     []string{"region=us-east"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseFilterArgs(tc.raw)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFilterArgs() error = %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("parseFilterArgs() = %#v, want %#v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("term %d = %#v, want %#v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func healthyStatus(name string, condStatus api.ConditionStatus, errMsg, msg string) api.ComponentStatus {
+	return api.ComponentStatus{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Conditions: []api.ComponentCondition{{
+			Type:    api.ComponentHealthy,
+			Status:  condStatus,
+			Error:   errMsg,
+			Message: msg,
+		}},
+	}
+}
+
+func TestMatchesFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    []string
+		status api.ComponentStatus
+		want   bool
+	}{
+		{
+			name:   "name glob matches",
+			raw:    []string{"name=etcd-*"},
+			status: healthyStatus("etcd-0", api.ConditionTrue, "", ""),
+			want:   true,
+		},
+		{
+			name:   "name glob does not match",
+			raw:    []string{"name=etcd-*"},
+			status: healthyStatus("scheduler", api.ConditionTrue, "", ""),
+			want:   false,
+		},
+		{
+			name:   "status exact match",
+			raw:    []string{"status=Healthy"},
+			status: healthyStatus("etcd-0", api.ConditionTrue, "", ""),
+			want:   true,
+		},
+		{
+			name:   "status negated match",
+			raw:    []string{"status=!Healthy"},
+			status: healthyStatus("etcd-0", api.ConditionFalse, "", ""),
+			want:   true,
+		},
+		{
+			name:   "status negated excludes healthy",
+			raw:    []string{"status=!Healthy"},
+			status: healthyStatus("etcd-0", api.ConditionTrue, "", ""),
+			want:   false,
+		},
+		{
+			name:   "error substring match",
+			raw:    []string{"error=timed out"},
+			status: healthyStatus("etcd-0", api.ConditionUnknown, "probe timed out after 5s", ""),
+			want:   true,
+		},
+		{
+			name:   "message substring match",
+			raw:    []string{"message=good"},
+			status: healthyStatus("etcd-0", api.ConditionTrue, "", "all good"),
+			want:   true,
+		},
+		{
+			name:   "AND semantics requires every term",
+			raw:    []string{"status=Healthy", "name=scheduler"},
+			status: healthyStatus("etcd-0", api.ConditionTrue, "", ""),
+			want:   false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			terms, err := parseFilterArgs(tc.raw)
+			if err != nil {
+				t.Fatalf("parseFilterArgs() error = %v", err)
+			}
+			if got := matchesFilters(tc.status, terms); got != tc.want {
+				t.Errorf("matchesFilters() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestFilterComponentStatusListWithConcurrentProducer mirrors how
+// REST.List assembles its reply: several goroutines push ComponentStatus
+// values onto a shared channel concurrently, and only once that channel is
+// drained is the filter grammar applied to the assembled list.
+func TestFilterComponentStatusListWithConcurrentProducer(t *testing.T) {
+	inputs := []api.ComponentStatus{
+		healthyStatus("etcd-0", api.ConditionTrue, "", ""),
+		healthyStatus("etcd-1", api.ConditionFalse, "connection refused", ""),
+		healthyStatus("scheduler", api.ConditionTrue, "", ""),
+	}
+
+	statuses := make(chan api.ComponentStatus, len(inputs))
+	var wg sync.WaitGroup
+	wg.Add(len(inputs))
+	for _, status := range inputs {
+		go func(s api.ComponentStatus) {
+			defer wg.Done()
+			statuses <- s
+		}(status)
+	}
+	wg.Wait()
+	close(statuses)
+
+	list := &api.ComponentStatusList{}
+	for status := range statuses {
+		list.Items = append(list.Items, status)
+	}
+
+	filtered, err := FilterComponentStatusList(list, []string{"name=etcd-*", "status=!Healthy"})
+	if err != nil {
+		t.Fatalf("FilterComponentStatusList() error = %v", err)
+	}
+
+	var names []string
+	for _, status := range filtered.Items {
+		names = append(names, status.Name)
+	}
+	sort.Strings(names)
+
+	if len(names) != 1 || names[0] != "etcd-1" {
+		t.Fatalf("expected only etcd-1 to survive the filter, got %v", names)
+	}
+}
+
+func TestListHonorsFilterArgsWhenEnabled(t *testing.T) {
+	check := func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		condStatus := api.ConditionTrue
+		if name == "etcd-1" {
+			condStatus = api.ConditionFalse
+		}
+		cs := healthyStatus(name, condStatus, "", "")
+		return &cs
+	}
+
+	rs := newTestREST(map[string]ServerEntry{
+		"etcd-0": {Server: &Server{}},
+		"etcd-1": {Server: &Server{}},
+	}, check)
+	rs.EnableFilters = true
+
+	ctx := WithFilterArgs(context.Background(), []string{"status=!Healthy"})
+	obj, err := rs.List(ctx, &metainternalversion.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	list := obj.(*api.ComponentStatusList)
+	if len(list.Items) != 1 || list.Items[0].Name != "etcd-1" {
+		t.Fatalf("expected only etcd-1, got %#v", list.Items)
+	}
+}
+
+// TestListHonorsFilterQueryParameterEndToEnd drives the actual decoder
+// (WithFilterArgsFromRequest) against a real *http.Request carrying a
+// `?filter=...` query parameter, the way a caller holding the incoming
+// request would, rather than calling WithFilterArgs directly.
+func TestListHonorsFilterQueryParameterEndToEnd(t *testing.T) {
+	check := func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		condStatus := api.ConditionTrue
+		if name == "etcd-1" {
+			condStatus = api.ConditionFalse
+		}
+		cs := healthyStatus(name, condStatus, "", "")
+		return &cs
+	}
+
+	rs := newTestREST(map[string]ServerEntry{
+		"etcd-0": {Server: &Server{}},
+		"etcd-1": {Server: &Server{}},
+	}, check)
+	rs.EnableFilters = true
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/componentstatuses?filter=status%3D%21Healthy", nil)
+	ctx := WithFilterArgsFromRequest(context.Background(), req)
+
+	obj, err := rs.List(ctx, &metainternalversion.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	list := obj.(*api.ComponentStatusList)
+	if len(list.Items) != 1 || list.Items[0].Name != "etcd-1" {
+		t.Fatalf("expected only etcd-1, got %#v", list.Items)
+	}
+}
+
+func TestDecodeFilterQueryParameter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/?filter=status%3DHealthy&filter=name%3Detcd-*", nil)
+	got := DecodeFilterQueryParameter(req.URL.Query())
+	want := []string{"status=Healthy", "name=etcd-*"}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("DecodeFilterQueryParameter() = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("DecodeFilterQueryParameter() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWithFilterArgsFromRequestNoopWithoutFilterParam(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/componentstatuses", nil)
+	ctx := WithFilterArgsFromRequest(context.Background(), req)
+	if raw := filterArgsFrom(ctx); len(raw) != 0 {
+		t.Fatalf("expected no filter args on ctx, got %v", raw)
+	}
+}
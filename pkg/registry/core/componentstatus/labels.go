@@ -0,0 +1,54 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseComponentStatusLabels parses component label entries, one per
+// component server, in the form "name=key=value[,key=value...]" (for
+// example "etcd-0=tier=control-plane,role=etcd"), into a map of server name
+// to its static labels. This package registers no command-line flag for
+// these entries. NewStaticServerSourceWithLabels calls this to populate
+// ServerEntry.Labels so that requests like "kubectl get cs -l
+// tier=control-plane" can filter results.
+func ParseComponentStatusLabels(raw []string) (map[string]map[string]string, error) {
+	result := make(map[string]map[string]string, len(raw))
+	for _, entry := range raw {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --component-status-labels entry %q: expected name=key=value[,key=value...]", entry)
+		}
+		name, rest := parts[0], parts[1]
+
+		set := make(map[string]string)
+		for _, pair := range strings.Split(rest, ",") {
+			if pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid label pair %q in --component-status-labels entry for %q", pair, name)
+			}
+			set[kv[0]] = kv[1]
+		}
+		result[name] = set
+	}
+	return result, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	api "k8s.io/kubernetes/pkg/apis/core"
+)
+
+func TestParseComponentStatusLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []string
+		want    map[string]map[string]string
+		wantErr bool
+	}{
+		{
+			name: "single entry multiple labels",
+			raw:  []string{"etcd-0=tier=control-plane,role=etcd"},
+			want: map[string]map[string]string{
+				"etcd-0": {"tier": "control-plane", "role": "etcd"},
+			},
+		},
+		{
+			name: "multiple entries",
+			raw:  []string{"etcd-0=role=etcd", "scheduler=role=scheduler"},
+			want: map[string]map[string]string{
+				"etcd-0":    {"role": "etcd"},
+				"scheduler": {"role": "scheduler"},
+			},
+		},
+		{
+			name: "entry with no labels",
+			raw:  []string{"etcd-0="},
+			want: map[string]map[string]string{
+				"etcd-0": {},
+			},
+		},
+		{
+			name:    "missing name",
+			raw:     []string{"=tier=control-plane"},
+			wantErr: true,
+		},
+		{
+			name:    "malformed label pair",
+			raw:     []string{"etcd-0=tier"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseComponentStatusLabels(tc.raw)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseComponentStatusLabels() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseComponentStatusLabels() = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestNewStaticServerSourceWithLabelsWiring drives label-entry parsing all
+// the way through to List's label selector.
+func TestNewStaticServerSourceWithLabelsWiring(t *testing.T) {
+	source, err := NewStaticServerSourceWithLabels(map[string]ServerEntry{
+		"etcd-0":    {Server: &Server{}},
+		"scheduler": {Server: &Server{}},
+	}, []string{"etcd-0=tier=control-plane,role=etcd"})
+	if err != nil {
+		t.Fatalf("NewStaticServerSourceWithLabels() error = %v", err)
+	}
+
+	rs := NewStorage(source)
+	rs.checkComponentFunc = func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		return &api.ComponentStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: entry.Labels},
+			Conditions: []api.ComponentCondition{{Type: api.ComponentHealthy, Status: api.ConditionTrue}},
+		}
+	}
+
+	selector, err := labels.Parse("tier=control-plane")
+	if err != nil {
+		t.Fatalf("labels.Parse() error = %v", err)
+	}
+
+	obj, err := rs.List(context.Background(), &metainternalversion.ListOptions{LabelSelector: selector})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	list := obj.(*api.ComponentStatusList)
+	if len(list.Items) != 1 || list.Items[0].Name != "etcd-0" {
+		t.Fatalf("expected only etcd-0 to match tier=control-plane, got %#v", list.Items)
+	}
+}
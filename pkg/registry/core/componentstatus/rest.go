@@ -18,11 +18,17 @@ package componentstatus
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/apiserver/pkg/registry/generic"
 	"k8s.io/apiserver/pkg/storage"
 
@@ -38,14 +44,61 @@ import (
 	"k8s.io/kubernetes/pkg/probe"
 )
 
+// ServerEntry associates a Server health-check target with the static
+// labels and annotations that should be attached to the ComponentStatus
+// object it produces, enabling label/field selection via the List and
+// Watch endpoints.
+type ServerEntry struct {
+	Server      *Server
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
 type REST struct {
-	GetServersToValidate func() map[string]*Server
+	// Source supplies the set of servers to probe and notifies the
+	// background monitor when that set changes.
+	Source ServerSource
+
+	// ProbeInterval controls how often the background monitor started by
+	// Watch polls every registered server for a health check. Zero means
+	// DefaultProbeInterval.
+	ProbeInterval time.Duration
+
+	// EnableFilters opts List into honoring the `filter` query parameter
+	// (see filter.go). It should only be set to true once the caller has
+	// confirmed ComponentStatusFiltersFeatureGate is enabled.
+	EnableFilters bool
+
+	broadcaster  *watch.Broadcaster
+	startMonitor sync.Once
+
+	mu              sync.Mutex
+	lastStatus      map[string]api.ComponentStatus
+	resourceVersion uint64
+
+	// history holds, in ascending resourceVersion order, the events
+	// broadcast by the last maxWatchHistory probe cycles, so Watch can
+	// replay exactly what a reconnecting client missed instead of either
+	// replaying everything or silently dropping transitions. historyFloor
+	// is the resourceVersion of the most recently evicted cycle: a Watch
+	// resuming from an older resourceVersion than historyFloor cannot be
+	// served and must be rejected so the client knows to re-list.
+	history      []historyCycle
+	historyFloor uint64
+
+	// checkComponentFunc, when set, replaces getComponentStatus as the way
+	// List/Get/the background monitor probe a single server. Tests use this
+	// to substitute a fake server check without performing real network I/O.
+	checkComponentFunc func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus
 }
 
-// NewStorage returns a new REST.
-func NewStorage(serverRetriever func() map[string]*Server) *REST {
+// NewStorage returns a new REST backed by source.
+func NewStorage(source ServerSource) *REST {
 	return &REST{
-		GetServersToValidate: serverRetriever,
+		Source:        source,
+		ProbeInterval: DefaultProbeInterval,
+		broadcaster:   watch.NewBroadcaster(watchQueueLength, watch.DropIfChannelFull),
+		lastStatus:    map[string]api.ComponentStatus{},
 	}
 }
 
@@ -67,38 +120,78 @@ func (rs *REST) NewList() runtime.Object {
 	return &api.ComponentStatusList{}
 }
 
-// Returns the list of component status. Note that the label and field are both ignored.
-// Note that this call doesn't support labels or selectors.
+// Returns the list of component status, filtered by options.LabelSelector
+// and options.FieldSelector and, when REST.EnableFilters is set, by any
+// `filter` expressions carried on ctx (see WithFilterArgs). Each server is
+// probed concurrently, bound by its own deadline (see Server.Timeout); a
+// server that misses its deadline contributes a Status=Unknown condition
+// rather than delaying the response, and caller cancellation of ctx aborts
+// all in-flight probes promptly. The returned list and every item carry a
+// freshly minted ResourceVersion (see stampResourceVersion), so a client
+// that follows List with Watch can pass it back as
+// options.ResourceVersion to resume from this point.
 func (rs *REST) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
-	servers := rs.GetServersToValidate()
+	servers := rs.Source.Servers()
 
-	wait := sync.WaitGroup{}
-	wait.Add(len(servers))
+	g, gctx := errgroup.WithContext(ctx)
 	statuses := make(chan api.ComponentStatus, len(servers))
 	for k, v := range servers {
-		go func(name string, server *Server) {
-			defer wait.Done()
-			status := rs.getComponentStatus(name, server)
-			statuses <- *status
-		}(k, v)
+		name, entry := k, v
+		g.Go(func() error {
+			statuses <- *rs.checkComponent(gctx, name, entry)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
-	wait.Wait()
 	close(statuses)
 
 	pred := componentStatusPredicate(options)
 
 	reply := []api.ComponentStatus{}
 	for status := range statuses {
-		// ComponentStatus resources currently (v1.14) do not support labeling, however the filtering is executed
-		// nonetheless in case the request contains Label or Field selectors (which will effectively filter out
-		// all of the results and return an empty response).
 		if matched := matchesPredicate(status, &pred); matched {
 			reply = append(reply, status)
 		}
 	}
-	return &api.ComponentStatusList{Items: reply}, nil
+	list := &api.ComponentStatusList{Items: reply}
+	rs.stampResourceVersion(list)
+
+	if rs.EnableFilters {
+		if raw := filterArgsFrom(ctx); len(raw) > 0 {
+			filtered, err := FilterComponentStatusList(list, raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter: %v", err)
+			}
+			return filtered, nil
+		}
+	}
+	return list, nil
 }
 
+// stampResourceVersion mints a fresh resource version for list and applies
+// it to both list.ListMeta and every item, so a caller can take the
+// returned ResourceVersion and pass it to Watch's options.ResourceVersion
+// to pick up from where this List left off (see Watch in watch.go).
+func (rs *REST) stampResourceVersion(list *api.ComponentStatusList) {
+	rs.mu.Lock()
+	rs.resourceVersion++
+	rv := strconv.FormatUint(rs.resourceVersion, 10)
+	rs.mu.Unlock()
+
+	list.ResourceVersion = rv
+	for i := range list.Items {
+		list.Items[i].ResourceVersion = rv
+	}
+}
+
+// componentStatusPredicate builds the SelectionPredicate used to filter
+// ComponentStatus objects for List and Watch. options.LabelSelector is a
+// labels.Selector already converted from the request's metav1.LabelSelector,
+// so set-based operators (In, NotIn, Exists, DoesNotExist) are honored for
+// free as long as the ComponentStatus objects being matched carry labels
+// (see ServerEntry.Labels and getComponentStatus).
 func componentStatusPredicate(options *metainternalversion.ListOptions) storage.SelectionPredicate {
 	pred := storage.SelectionPredicate{
 		Label:       labels.Everything(),
@@ -127,12 +220,12 @@ func matchesPredicate(status api.ComponentStatus, pred *storage.SelectionPredica
 }
 
 func (rs *REST) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
-	servers := rs.GetServersToValidate()
+	servers := rs.Source.Servers()
 
-	if server, ok := servers[name]; !ok {
+	if entry, ok := servers[name]; !ok {
 		return nil, fmt.Errorf("Component not found: %s", name)
 	} else {
-		return rs.getComponentStatus(name, server), nil
+		return rs.checkComponent(ctx, name, entry), nil
 	}
 }
 
@@ -147,16 +240,36 @@ func ToConditionStatus(s probe.Result) api.ConditionStatus {
 	}
 }
 
-func (rs *REST) getComponentStatus(name string, server *Server) *api.ComponentStatus {
-	status, msg, err := server.DoServerCheck()
+// checkComponent probes a single server, using checkComponentFunc instead of
+// getComponentStatus when the former is set (tests only).
+func (rs *REST) checkComponent(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+	if rs.checkComponentFunc != nil {
+		return rs.checkComponentFunc(ctx, name, entry)
+	}
+	return rs.getComponentStatus(ctx, name, entry)
+}
+
+func (rs *REST) getComponentStatus(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+	timeout := entry.Server.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+
+	status, msg, err := entry.Server.DoServerCheck(ctx)
+
+	condStatus := ToConditionStatus(status)
 	errorMsg := ""
 	if err != nil {
 		errorMsg = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			condStatus = api.ConditionUnknown
+			errorMsg = fmt.Sprintf("probe timed out after %s", timeout)
+		}
 	}
 
 	c := &api.ComponentCondition{
 		Type:    api.ComponentHealthy,
-		Status:  ToConditionStatus(status),
+		Status:  condStatus,
 		Message: msg,
 		Error:   errorMsg,
 	}
@@ -165,6 +278,12 @@ func (rs *REST) getComponentStatus(name string, server *Server) *api.ComponentSt
 		Conditions: []api.ComponentCondition{*c},
 	}
 	retVal.Name = name
+	if len(entry.Labels) > 0 {
+		retVal.Labels = entry.Labels
+	}
+	if len(entry.Annotations) > 0 {
+		retVal.Annotations = entry.Annotations
+	}
 
 	return retVal
 }
@@ -172,6 +291,9 @@ func (rs *REST) getComponentStatus(name string, server *Server) *api.ComponentSt
 // Implement ShortNamesProvider
 var _ rest.ShortNamesProvider = &REST{}
 
+// Implement Watcher
+var _ rest.Watcher = &REST{}
+
 // ShortNames implements the ShortNamesProvider interface. Returns a list of short names for a resource.
 func (r *REST) ShortNames() []string {
 	return []string{"cs"}
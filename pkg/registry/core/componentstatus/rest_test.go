@@ -0,0 +1,247 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "k8s.io/kubernetes/pkg/apis/core"
+	"k8s.io/kubernetes/pkg/probe"
+)
+
+func newTestREST(servers map[string]ServerEntry, check func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus) *REST {
+	rs := NewStorage(NewStaticServerSource(servers))
+	rs.ProbeInterval = 5 * time.Millisecond
+	rs.checkComponentFunc = check
+	return rs
+}
+
+func TestWatchEmitsModifiedOnConditionFlip(t *testing.T) {
+	var mu sync.Mutex
+	healthy := true
+
+	check := func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		mu.Lock()
+		status := probe.Success
+		if !healthy {
+			status = probe.Failure
+		}
+		mu.Unlock()
+		return &api.ComponentStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Conditions: []api.ComponentCondition{{
+				Type:   api.ComponentHealthy,
+				Status: ToConditionStatus(status),
+			}},
+		}
+	}
+
+	rs := newTestREST(map[string]ServerEntry{"etcd-0": {Server: &Server{}}}, check)
+
+	w, err := rs.Watch(context.Background(), &metainternalversion.ListOptions{})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer w.Stop()
+
+	// First event observed is the initial ADDED snapshot (Healthy).
+	if e := nextEvent(t, w, time.Second); e.Type != watch.Added {
+		t.Fatalf("expected initial event type Added, got %v", e.Type)
+	}
+
+	mu.Lock()
+	healthy = false
+	mu.Unlock()
+
+	e := nextEvent(t, w, time.Second)
+	if e.Type != watch.Modified {
+		t.Fatalf("expected Modified event after condition flip, got %v", e.Type)
+	}
+	cs := e.Object.(*api.ComponentStatus)
+	if cs.Conditions[0].Status != api.ConditionFalse {
+		t.Fatalf("expected flipped condition to be %s, got %s", api.ConditionFalse, cs.Conditions[0].Status)
+	}
+}
+
+func TestWatchSlowWatcherDoesNotBlockProbes(t *testing.T) {
+	// Flip the condition on every probe so each cycle broadcasts an event.
+	var mu sync.Mutex
+	healthy := true
+	check := func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		mu.Lock()
+		healthy = !healthy
+		status := api.ConditionTrue
+		if !healthy {
+			status = api.ConditionFalse
+		}
+		mu.Unlock()
+		return &api.ComponentStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Conditions: []api.ComponentCondition{{Type: api.ComponentHealthy, Status: status}},
+		}
+	}
+
+	rs := newTestREST(map[string]ServerEntry{"etcd-0": {Server: &Server{}}}, check)
+
+	slow, err := rs.Watch(context.Background(), &metainternalversion.ListOptions{})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer slow.Stop()
+	// Never drain slow's ResultChan(), simulating a stuck client.
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	done := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		// Drive enough probe cycles to overflow the slow watcher's buffer.
+		for i := 0; i < watchQueueLength+10; i++ {
+			rs.probeOnce()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("probeOnce blocked on a slow watcher instead of dropping its events")
+	}
+	wg.Wait()
+}
+
+func TestListStampsResourceVersion(t *testing.T) {
+	check := func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		return &api.ComponentStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Conditions: []api.ComponentCondition{{Type: api.ComponentHealthy, Status: api.ConditionTrue}},
+		}
+	}
+
+	rs := newTestREST(map[string]ServerEntry{"etcd-0": {Server: &Server{}}}, check)
+
+	obj, err := rs.List(context.Background(), &metainternalversion.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	list := obj.(*api.ComponentStatusList)
+	if list.ResourceVersion == "" {
+		t.Fatal("expected List() to stamp ListMeta.ResourceVersion, got empty string")
+	}
+	if len(list.Items) != 1 || list.Items[0].ResourceVersion != list.ResourceVersion {
+		t.Fatalf("expected item ResourceVersion to match list ResourceVersion %q, got %#v", list.ResourceVersion, list.Items)
+	}
+}
+
+func TestWatchResumeReplaysMissedTransitions(t *testing.T) {
+	var mu sync.Mutex
+	healthy := true
+
+	check := func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		mu.Lock()
+		status := probe.Success
+		if !healthy {
+			status = probe.Failure
+		}
+		mu.Unlock()
+		return &api.ComponentStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Conditions: []api.ComponentCondition{{
+				Type:   api.ComponentHealthy,
+				Status: ToConditionStatus(status),
+			}},
+		}
+	}
+
+	rs := newTestREST(map[string]ServerEntry{"etcd-0": {Server: &Server{}}}, check)
+
+	// Drive cycles directly instead of the ticker, so the RV a hypothetical
+	// earlier client would have observed is known precisely.
+	rs.probeOnce()
+	rs.mu.Lock()
+	lastKnownRV := strconv.FormatUint(rs.resourceVersion, 10)
+	rs.mu.Unlock()
+
+	// The condition flips while that client is "disconnected".
+	mu.Lock()
+	healthy = false
+	mu.Unlock()
+	rs.probeOnce()
+
+	w, err := rs.Watch(context.Background(), &metainternalversion.ListOptions{ResourceVersion: lastKnownRV})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer w.Stop()
+
+	e := nextEvent(t, w, time.Second)
+	if e.Type != watch.Modified {
+		t.Fatalf("expected the missed Modified transition to be replayed, got %v", e.Type)
+	}
+	cs := e.Object.(*api.ComponentStatus)
+	if cs.Conditions[0].Status != api.ConditionFalse {
+		t.Fatalf("expected flipped condition to be %s, got %s", api.ConditionFalse, cs.Conditions[0].Status)
+	}
+}
+
+func TestWatchResumeFromExpiredResourceVersionForcesRelist(t *testing.T) {
+	check := func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		return &api.ComponentStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Conditions: []api.ComponentCondition{{Type: api.ComponentHealthy, Status: api.ConditionTrue}},
+		}
+	}
+
+	rs := newTestREST(map[string]ServerEntry{"etcd-0": {Server: &Server{}}}, check)
+
+	// Run enough cycles to evict the earliest resourceVersion from history.
+	for i := 0; i < maxWatchHistory+5; i++ {
+		rs.probeOnce()
+	}
+
+	_, err := rs.Watch(context.Background(), &metainternalversion.ListOptions{ResourceVersion: "1"})
+	if err == nil {
+		t.Fatal("expected Watch() to reject a resourceVersion older than the retained history")
+	}
+	if !apierrors.IsResourceExpired(err) {
+		t.Fatalf("expected a ResourceExpired error forcing a re-list, got %v (%T)", err, err)
+	}
+}
+
+func nextEvent(t *testing.T, w watch.Interface, timeout time.Duration) watch.Event {
+	t.Helper()
+	select {
+	case e, ok := <-w.ResultChan():
+		if !ok {
+			t.Fatal("watch channel closed unexpectedly")
+		}
+		return e
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for watch event")
+		return watch.Event{}
+	}
+}
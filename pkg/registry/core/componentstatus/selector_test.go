@@ -0,0 +1,120 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	api "k8s.io/kubernetes/pkg/apis/core"
+)
+
+func newLabeledStatus(name string, labels map[string]string) api.ComponentStatus {
+	return api.ComponentStatus{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+	}
+}
+
+func TestMatchesPredicateLabelSelectorOperators(t *testing.T) {
+	tests := []struct {
+		name       string
+		expr       metav1.LabelSelectorRequirement
+		statusSets []map[string]string
+		want       []bool
+	}{
+		{
+			name: "In",
+			expr: metav1.LabelSelectorRequirement{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"control-plane"}},
+			statusSets: []map[string]string{
+				{"tier": "control-plane"},
+				{"tier": "node"},
+			},
+			want: []bool{true, false},
+		},
+		{
+			name: "NotIn",
+			expr: metav1.LabelSelectorRequirement{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"control-plane"}},
+			statusSets: []map[string]string{
+				{"tier": "control-plane"},
+				{"tier": "node"},
+			},
+			want: []bool{false, true},
+		},
+		{
+			name: "Exists",
+			expr: metav1.LabelSelectorRequirement{Key: "role", Operator: metav1.LabelSelectorOpExists},
+			statusSets: []map[string]string{
+				{"role": "etcd"},
+				{"tier": "control-plane"},
+			},
+			want: []bool{true, false},
+		},
+		{
+			name: "DoesNotExist",
+			expr: metav1.LabelSelectorRequirement{Key: "role", Operator: metav1.LabelSelectorOpDoesNotExist},
+			statusSets: []map[string]string{
+				{"role": "etcd"},
+				{"tier": "control-plane"},
+			},
+			want: []bool{false, true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ls := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{tc.expr}}
+			selector, err := metav1.LabelSelectorAsSelector(ls)
+			if err != nil {
+				t.Fatalf("LabelSelectorAsSelector() error = %v", err)
+			}
+
+			pred := componentStatusPredicate(&metainternalversion.ListOptions{LabelSelector: selector})
+
+			for i, set := range tc.statusSets {
+				status := newLabeledStatus("component", set)
+				if got := matchesPredicate(status, &pred); got != tc.want[i] {
+					t.Errorf("matchesPredicate(%v) = %v, want %v", set, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestComponentStatusPredicateEmptyVsNilSelector(t *testing.T) {
+	status := newLabeledStatus("component", nil)
+
+	nilPred := componentStatusPredicate(nil)
+	if !matchesPredicate(status, &nilPred) {
+		t.Error("expected a nil ListOptions to match everything")
+	}
+
+	emptyPred := componentStatusPredicate(&metainternalversion.ListOptions{})
+	if !matchesPredicate(status, &emptyPred) {
+		t.Error("expected ListOptions with no selectors to match everything")
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{})
+	if err != nil {
+		t.Fatalf("LabelSelectorAsSelector() error = %v", err)
+	}
+	emptySelectorPred := componentStatusPredicate(&metainternalversion.ListOptions{LabelSelector: selector})
+	if !matchesPredicate(status, &emptySelectorPred) {
+		t.Error("expected an empty (non-nil) LabelSelector to match everything")
+	}
+}
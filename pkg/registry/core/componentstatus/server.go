@@ -0,0 +1,89 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/kubernetes/pkg/probe"
+	httpprobe "k8s.io/kubernetes/pkg/probe/http"
+)
+
+// DefaultProbeTimeout is the per-server deadline used when Server.Timeout is
+// unset.
+const DefaultProbeTimeout = 5 * time.Second
+
+// Server carries the address of a single component-status target (an etcd
+// member, a scheduler replica, ...) along with how to reach its health
+// endpoint.
+type Server struct {
+	Addr        string
+	Port        int
+	Path        string
+	EnableHTTPS bool
+	TLSConfig   *tls.Config
+
+	// Timeout bounds a single DoServerCheck call. Zero means
+	// DefaultProbeTimeout.
+	Timeout time.Duration
+}
+
+// DoServerCheck probes the server's health endpoint once and returns the
+// probe result, any message returned by the endpoint, and an error if the
+// probe itself could not be completed. The probe is bound by the earlier of
+// ctx's deadline and the server's own Timeout; if that bound ends the probe,
+// the result is probe.Unknown and the error is the context's error (for a
+// missed deadline, context.DeadlineExceeded).
+func (server *Server) DoServerCheck(ctx context.Context) (probe.Result, string, error) {
+	timeout := server.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	scheme := "http"
+	if server.EnableHTTPS {
+		scheme = "https"
+	}
+
+	transport := utilnet.SetTransportDefaults(&http.Transport{
+		TLSClientConfig: server.TLSConfig,
+	})
+
+	url := fmt.Sprintf("%s://%s/%s", scheme, net.JoinHostPort(server.Addr, strconv.Itoa(server.Port)), server.Path)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return probe.Unknown, "", err
+	}
+
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	prober := httpprobe.New()
+	result, msg, err := prober.Probe(req, client.Timeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return probe.Unknown, "", ctxErr
+	}
+	return result, msg, err
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ServerSource supplies the set of Server targets that ComponentStatus
+// probes, and notifies REST's background monitor when that set changes so
+// new members can be picked up without waiting for the next probe tick.
+type ServerSource interface {
+	// Servers returns the current set of servers to probe, keyed by the
+	// name each will be reported under.
+	Servers() map[string]ServerEntry
+
+	// Changed returns a channel that receives a value whenever Servers has
+	// changed. Implementations that never change may return nil, which
+	// blocks forever in a select and is safe to read from.
+	Changed() <-chan struct{}
+}
+
+// staticServerSource implements ServerSource over the fixed set of servers
+// configured at apiserver startup (e.g. via --etcd-servers-style flags).
+type staticServerSource struct {
+	servers map[string]ServerEntry
+}
+
+// NewStaticServerSource returns a ServerSource that always reports the same
+// fixed set of servers and never signals a change.
+func NewStaticServerSource(servers map[string]ServerEntry) ServerSource {
+	return &staticServerSource{servers: servers}
+}
+
+func (s *staticServerSource) Servers() map[string]ServerEntry { return s.servers }
+func (s *staticServerSource) Changed() <-chan struct{}        { return nil }
+
+// NewStaticServerSourceWithLabels turns raw component label entries into a
+// usable ServerSource: it parses rawLabels with ParseComponentStatusLabels
+// and applies the result onto the
+// matching entries of servers before handing them to NewStaticServerSource,
+// so that e.g. "kubectl get cs -l tier=control-plane" can select them.
+// Entries in rawLabels that don't name a server in servers are ignored.
+func NewStaticServerSourceWithLabels(servers map[string]ServerEntry, rawLabels []string) (ServerSource, error) {
+	parsed, err := ParseComponentStatusLabels(rawLabels)
+	if err != nil {
+		return nil, err
+	}
+	for name, labelSet := range parsed {
+		entry, ok := servers[name]
+		if !ok {
+			continue
+		}
+		entry.Labels = labelSet
+		servers[name] = entry
+	}
+	return NewStaticServerSource(servers), nil
+}
+
+// EndpointServerSourceOptions configures how an endpoint-backed ServerSource
+// turns a matched Endpoints address into a Server.
+type EndpointServerSourceOptions struct {
+	// Namespace to watch Endpoints in, typically "kube-system".
+	Namespace string
+	// Selector restricts discovery to Endpoints carrying matching labels,
+	// e.g. "component in (etcd,scheduler,controller-manager)".
+	Selector labels.Selector
+
+	HealthPort  int
+	HealthPath  string
+	EnableHTTPS bool
+}
+
+// endpointServerSource discovers component servers dynamically by watching
+// Endpoints matching opts.Selector, materializing one Server per ready
+// address across all matched Endpoints' subsets.
+type endpointServerSource struct {
+	opts     EndpointServerSourceOptions
+	informer cache.SharedIndexInformer
+
+	mu      sync.Mutex
+	servers map[string]ServerEntry
+
+	changed chan struct{}
+}
+
+// NewEndpointServerSource returns a ServerSource that watches Endpoints in
+// opts.Namespace matching opts.Selector and keeps one Server per ready
+// address up to date as members join and leave. The informer is started
+// immediately and runs until stopCh is closed.
+func NewEndpointServerSource(client kubernetes.Interface, opts EndpointServerSourceOptions, stopCh <-chan struct{}) ServerSource {
+	selector := opts.Selector
+	if selector == nil {
+		selector = labels.Everything()
+	}
+
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector.String()
+			return client.CoreV1().Endpoints(opts.Namespace).List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector.String()
+			return client.CoreV1().Endpoints(opts.Namespace).Watch(context.TODO(), options)
+		},
+	}
+
+	s := &endpointServerSource{
+		opts:    opts,
+		servers: map[string]ServerEntry{},
+		changed: make(chan struct{}, 1),
+	}
+
+	s.informer = cache.NewSharedIndexInformer(lw, &corev1.Endpoints{}, 0, cache.Indexers{})
+	s.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { s.rebuild() },
+		UpdateFunc: func(oldObj, newObj interface{}) { s.rebuild() },
+		DeleteFunc: func(obj interface{}) { s.rebuild() },
+	})
+
+	go s.informer.Run(stopCh)
+
+	return s
+}
+
+// rebuild recomputes the full server map from the informer's current store
+// and notifies Changed if anything might have changed.
+func (s *endpointServerSource) rebuild() {
+	servers := make(map[string]ServerEntry)
+	for _, obj := range s.informer.GetStore().List() {
+		ep, ok := obj.(*corev1.Endpoints)
+		if !ok {
+			continue
+		}
+		for _, subset := range ep.Subsets {
+			for _, addr := range subset.Addresses {
+				servers[endpointServerName(ep, addr)] = ServerEntry{
+					Server: &Server{
+						Addr:        addr.IP,
+						Port:        s.opts.HealthPort,
+						Path:        s.opts.HealthPath,
+						EnableHTTPS: s.opts.EnableHTTPS,
+					},
+					Labels:      ep.Labels,
+					Annotations: ep.Annotations,
+				}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.servers = servers
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+		// A signal is already pending; the next probe cycle will see the
+		// latest snapshot either way.
+	}
+}
+
+func endpointServerName(ep *corev1.Endpoints, addr corev1.EndpointAddress) string {
+	if addr.TargetRef != nil && addr.TargetRef.Name != "" {
+		return fmt.Sprintf("%s-%s", ep.Name, addr.TargetRef.Name)
+	}
+	return fmt.Sprintf("%s-%s", ep.Name, addr.IP)
+}
+
+func (s *endpointServerSource) Servers() map[string]ServerEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]ServerEntry, len(s.servers))
+	for k, v := range s.servers {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *endpointServerSource) Changed() <-chan struct{} {
+	return s.changed
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "k8s.io/kubernetes/pkg/apis/core"
+)
+
+// fakeServerSource is a ServerSource whose member set and change
+// notifications are controlled directly by tests, standing in for a real
+// endpointServerSource without performing any network discovery.
+type fakeServerSource struct {
+	mu      sync.Mutex
+	servers map[string]ServerEntry
+	changed chan struct{}
+}
+
+func newFakeServerSource(servers map[string]ServerEntry) *fakeServerSource {
+	return &fakeServerSource{
+		servers: servers,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+func (s *fakeServerSource) Servers() map[string]ServerEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]ServerEntry, len(s.servers))
+	for k, v := range s.servers {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *fakeServerSource) Changed() <-chan struct{} { return s.changed }
+
+// add introduces a synthetic member and signals the change, as a real
+// endpointServerSource would when a new Endpoints address becomes ready.
+func (s *fakeServerSource) add(name string, entry ServerEntry) {
+	s.mu.Lock()
+	s.servers[name] = entry
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// remove drops a member and signals the change.
+func (s *fakeServerSource) remove(name string) {
+	s.mu.Lock()
+	delete(s.servers, name)
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func TestWatchObservesDynamicMembershipChanges(t *testing.T) {
+	check := func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		return &api.ComponentStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Conditions: []api.ComponentCondition{{Type: api.ComponentHealthy, Status: api.ConditionTrue}},
+		}
+	}
+
+	source := newFakeServerSource(map[string]ServerEntry{"etcd-0": {Server: &Server{}}})
+
+	rs := NewStorage(source)
+	rs.ProbeInterval = time.Hour // rely on Changed() rather than the tick
+	rs.checkComponentFunc = check
+
+	w, err := rs.Watch(context.Background(), &metainternalversion.ListOptions{})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer w.Stop()
+
+	if e := nextEvent(t, w, time.Second); e.Type != watch.Added {
+		t.Fatalf("expected initial event type Added, got %v", e.Type)
+	}
+
+	source.add("etcd-1", ServerEntry{Server: &Server{}})
+
+	added := nextEvent(t, w, time.Second)
+	if added.Type != watch.Added {
+		t.Fatalf("expected Added event for the new member, got %v", added.Type)
+	}
+	if cs := added.Object.(*api.ComponentStatus); cs.Name != "etcd-1" {
+		t.Fatalf("expected Added event for etcd-1, got %s", cs.Name)
+	}
+
+	source.remove("etcd-1")
+
+	deleted := nextEvent(t, w, time.Second)
+	if deleted.Type != watch.Deleted {
+		t.Fatalf("expected Deleted event after removal, got %v", deleted.Type)
+	}
+	if cs := deleted.Object.(*api.ComponentStatus); cs.Name != "etcd-1" {
+		t.Fatalf("expected Deleted event for etcd-1, got %s", cs.Name)
+	}
+}
+
+// TestEndpointServerSourceDiscoversEndpointAddedMidRun is an integration
+// test for the real endpointServerSource/NewEndpointServerSource, driven
+// through a fake clientset's informer rather than the hand-written
+// fakeServerSource above: it adds a synthetic Endpoints object mid-run and
+// asserts rebuild() picks it up as a new ServerEntry.
+func TestEndpointServerSourceDiscoversEndpointAddedMidRun(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	selector, err := labels.Parse("component=etcd")
+	if err != nil {
+		t.Fatalf("labels.Parse() error = %v", err)
+	}
+
+	source := NewEndpointServerSource(client, EndpointServerSourceOptions{
+		Namespace:  "kube-system",
+		Selector:   selector,
+		HealthPort: 2381,
+		HealthPath: "healthz",
+	}, stopCh)
+
+	waitForServerCount(t, source, 0)
+
+	ep := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "etcd-0",
+			Namespace:   "kube-system",
+			Labels:      map[string]string{"component": "etcd"},
+			Annotations: map[string]string{"owner": "etcd-team"},
+		},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{
+				IP:        "10.0.0.5",
+				TargetRef: &corev1.ObjectReference{Name: "etcd-0"},
+			}},
+		}},
+	}
+	if _, err := client.CoreV1().Endpoints("kube-system").Create(context.TODO(), ep, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	servers := waitForServerCount(t, source, 1)
+	entry, ok := servers["etcd-0-etcd-0"]
+	if !ok {
+		t.Fatalf("expected a server named etcd-0-etcd-0, got %#v", servers)
+	}
+	if entry.Server.Addr != "10.0.0.5" || entry.Server.Port != 2381 || entry.Server.Path != "healthz" {
+		t.Fatalf("unexpected server entry %#v", entry.Server)
+	}
+	if entry.Labels["component"] != "etcd" {
+		t.Fatalf("expected the Endpoints' labels to be carried onto the entry, got %#v", entry.Labels)
+	}
+	if entry.Annotations["owner"] != "etcd-team" {
+		t.Fatalf("expected the Endpoints' annotations to be carried onto the entry, got %#v", entry.Annotations)
+	}
+}
+
+// waitForServerCount polls source.Servers() until it has exactly want
+// entries, failing the test if that doesn't happen before the deadline.
+// The informer's list/watch delivery against the fake clientset is
+// asynchronous, so a direct read right after Create would be flaky.
+func waitForServerCount(t *testing.T, source ServerSource, want int) map[string]ServerEntry {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		servers := source.Servers()
+		if len(servers) == want {
+			return servers
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for %d server(s), last saw %#v", want, servers)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	api "k8s.io/kubernetes/pkg/apis/core"
+	"k8s.io/kubernetes/pkg/probe"
+)
+
+// serverPointedAt returns a Server wired to reach ts, so DoServerCheck
+// performs a real HTTP round trip against it instead of a fake check.
+func serverPointedAt(t *testing.T, ts *httptest.Server, timeout time.Duration) *Server {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("SplitHostPort() error = %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("Atoi(%q) error = %v", portStr, err)
+	}
+	return &Server{Addr: host, Port: port, Timeout: timeout}
+}
+
+// sleepyCheck simulates a wedged server: it blocks until either its sleep
+// elapses or ctx is done, whichever comes first.
+func sleepyCheck(sleep time.Duration) func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+	return func(ctx context.Context, name string, entry ServerEntry) *api.ComponentStatus {
+		select {
+		case <-time.After(sleep):
+			return &api.ComponentStatus{
+				Conditions: []api.ComponentCondition{{Type: api.ComponentHealthy, Status: ToConditionStatus(probe.Success)}},
+			}
+		case <-ctx.Done():
+			return &api.ComponentStatus{
+				Conditions: []api.ComponentCondition{{
+					Type:   api.ComponentHealthy,
+					Status: api.ConditionUnknown,
+					Error:  fmt.Sprintf("probe timed out after %s", 50*time.Millisecond),
+				}},
+			}
+		}
+	}
+}
+
+func TestListReturnsWithinDeadlinePlusDelta(t *testing.T) {
+	rs := newTestREST(map[string]ServerEntry{
+		"wedged": {Server: &Server{Timeout: 50 * time.Millisecond}},
+	}, sleepyCheck(10*time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	obj, err := rs.List(ctx, &metainternalversion.ListOptions{})
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("List() took %s, expected it to return promptly once ctx deadline passed", elapsed)
+	}
+
+	list := obj.(*api.ComponentStatusList)
+	if len(list.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(list.Items))
+	}
+	if got := list.Items[0].Conditions[0].Status; got != api.ConditionUnknown {
+		t.Errorf("expected Status=Unknown for the timed-out probe, got %s", got)
+	}
+}
+
+// TestListAgainstRealServerThatSleepsPastDeadline drives the actual
+// getComponentStatus/Server.DoServerCheck code path (rs.checkComponentFunc
+// is left unset) against a real httptest server whose handler sleeps past
+// the configured Server.Timeout, verifying the ctx-cancellation and
+// errors.Is(err, context.DeadlineExceeded) -> Status=Unknown synthesis in
+// rest.go actually fires rather than only being exercised via a
+// hand-rolled fake check.
+func TestListAgainstRealServerThatSleepsPastDeadline(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	rs := NewStorage(NewStaticServerSource(map[string]ServerEntry{
+		"wedged": {Server: serverPointedAt(t, ts, 50*time.Millisecond)},
+	}))
+
+	start := time.Now()
+	obj, err := rs.List(context.Background(), &metainternalversion.ListOptions{})
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if elapsed > 2*time.Second {
+		t.Fatalf("List() took %s, expected it to return promptly once the per-server deadline passed", elapsed)
+	}
+
+	list := obj.(*api.ComponentStatusList)
+	if len(list.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(list.Items))
+	}
+	cond := list.Items[0].Conditions[0]
+	if cond.Status != api.ConditionUnknown {
+		t.Errorf("expected Status=Unknown for the timed-out probe, got %s", cond.Status)
+	}
+	if cond.Error == "" {
+		t.Error("expected a non-empty probe timeout error message")
+	}
+}
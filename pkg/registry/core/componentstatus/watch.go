@@ -0,0 +1,299 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package componentstatus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	api "k8s.io/kubernetes/pkg/apis/core"
+)
+
+const (
+	// DefaultProbeInterval is how often the background monitor probes every
+	// registered server for a health check when REST.ProbeInterval is unset.
+	DefaultProbeInterval = 10 * time.Second
+
+	// watchQueueLength bounds how many buffered events a single watcher may
+	// fall behind by before the broadcaster starts dropping events to it
+	// instead of blocking the probe loop.
+	watchQueueLength = 100
+
+	// maxWatchHistory bounds how many probe cycles' worth of events REST
+	// retains for Watch to replay when a caller resumes from a specific
+	// ResourceVersion. A resume older than that history is rejected (see
+	// eventsSince) rather than served incompletely.
+	maxWatchHistory = 100
+)
+
+// historyCycle is one probe cycle's worth of broadcast events, recorded so
+// Watch can replay exactly what a reconnecting client missed.
+type historyCycle struct {
+	rv     uint64
+	events []watch.Event
+}
+
+// Watch implements rest.Watcher. It starts the background prober on first
+// use and streams ADDED/MODIFIED/DELETED events derived from transitions of
+// each component's ComponentHealthy condition, filtered by the selectors in
+// options. When options.ResourceVersion is empty or "0" (the standard
+// "give me everything, then watch" request), the current snapshot is
+// replayed as a burst of ADDED events before live events flow. Any other
+// ResourceVersion is treated as a resume point: REST replays the events
+// that actually occurred after it from its bounded history (see
+// eventsSince), or, if that history no longer reaches back far enough,
+// returns a "resource version too old" error so the caller re-lists
+// instead of silently missing transitions.
+func (rs *REST) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	rs.ensureMonitorStarted()
+
+	pred := componentStatusPredicate(options)
+
+	var initial []watch.Event
+	if resumingFromResourceVersion(options) {
+		target, err := strconv.ParseUint(options.ResourceVersion, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resourceVersion %q: %v", options.ResourceVersion, err)
+		}
+		events, ok := rs.eventsSince(target)
+		if !ok {
+			return nil, apierrors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (oldest available is %d)", target, rs.historyFloor))
+		}
+		initial = events
+	} else {
+		rs.mu.Lock()
+		initial = make([]watch.Event, 0, len(rs.lastStatus))
+		for _, status := range rs.lastStatus {
+			initial = append(initial, watch.Event{Type: watch.Added, Object: status.DeepCopy()})
+		}
+		rs.mu.Unlock()
+	}
+
+	w, err := rs.broadcaster.Watch()
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(newInitialEventsWatch(initial, w), func(in watch.Event) (watch.Event, bool) {
+		status, ok := in.Object.(*api.ComponentStatus)
+		if !ok {
+			return in, true
+		}
+		return in, matchesPredicate(*status, &pred)
+	}), nil
+}
+
+// resumingFromResourceVersion reports whether options asks Watch to resume
+// from a specific point rather than start fresh. Per the usual list/watch
+// convention, an empty or "0" ResourceVersion means "start fresh"; any other
+// value means the caller already has state as of that version (typically
+// obtained from a prior List, see REST.List) and wants exactly what it
+// missed replayed, not the full current state.
+func resumingFromResourceVersion(options *metainternalversion.ListOptions) bool {
+	return options != nil && options.ResourceVersion != "" && options.ResourceVersion != "0"
+}
+
+// eventsSince returns every event recorded after target, in order, along
+// with true if rs.history still reaches back that far. It returns false
+// when target predates historyFloor: some cycle between target and the
+// oldest retained history may have been evicted, so completeness can't be
+// guaranteed and the caller must force a re-list instead.
+func (rs *REST) eventsSince(target uint64) ([]watch.Event, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if target < rs.historyFloor {
+		return nil, false
+	}
+
+	var events []watch.Event
+	for _, cycle := range rs.history {
+		if cycle.rv <= target {
+			continue
+		}
+		events = append(events, cycle.events...)
+	}
+	return events, true
+}
+
+// ensureMonitorStarted lazily starts the single background goroutine that
+// probes all registered servers on REST.ProbeInterval.
+func (rs *REST) ensureMonitorStarted() {
+	rs.startMonitor.Do(func() {
+		go rs.runMonitor()
+	})
+}
+
+func (rs *REST) runMonitor() {
+	interval := rs.ProbeInterval
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	rs.probeOnce()
+	for {
+		select {
+		case <-ticker.C:
+		case <-rs.Source.Changed():
+		}
+		rs.probeOnce()
+	}
+}
+
+// probeOnce runs one probe cycle across every registered server, diffs the
+// result against the previous cycle's snapshot, and broadcasts an event for
+// every component that is new, changed, or has disappeared.
+func (rs *REST) probeOnce() {
+	servers := rs.Source.Servers()
+
+	wait := sync.WaitGroup{}
+	wait.Add(len(servers))
+	statuses := make(chan api.ComponentStatus, len(servers))
+	for k, v := range servers {
+		go func(name string, entry ServerEntry) {
+			defer wait.Done()
+			statuses <- *rs.checkComponent(context.Background(), name, entry)
+		}(k, v)
+	}
+	wait.Wait()
+	close(statuses)
+
+	seen := make(map[string]api.ComponentStatus, len(servers))
+	for status := range statuses {
+		seen[status.Name] = status
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.resourceVersion++
+	rvNum := rs.resourceVersion
+	rv := strconv.FormatUint(rvNum, 10)
+
+	var cycleEvents []watch.Event
+	broadcast := func(t watch.EventType, status api.ComponentStatus) {
+		rs.broadcaster.Action(t, status.DeepCopy())
+		cycleEvents = append(cycleEvents, watch.Event{Type: t, Object: status.DeepCopy()})
+	}
+
+	for name, status := range seen {
+		status.ResourceVersion = rv
+		seen[name] = status
+
+		prior, existed := rs.lastStatus[name]
+		rs.lastStatus[name] = status
+		if !existed {
+			broadcast(watch.Added, status)
+			continue
+		}
+		if !reflect.DeepEqual(prior.Conditions, status.Conditions) {
+			broadcast(watch.Modified, status)
+		}
+	}
+
+	for name, prior := range rs.lastStatus {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		delete(rs.lastStatus, name)
+		deleted := prior
+		deleted.ResourceVersion = rv
+		broadcast(watch.Deleted, deleted)
+	}
+
+	rs.recordHistory(rvNum, cycleEvents)
+}
+
+// recordHistory appends this cycle's events to rs.history, trimming the
+// oldest cycle and advancing historyFloor once the bound is exceeded. Must
+// be called with rs.mu held.
+func (rs *REST) recordHistory(rv uint64, events []watch.Event) {
+	rs.history = append(rs.history, historyCycle{rv: rv, events: events})
+	if len(rs.history) > maxWatchHistory {
+		rs.historyFloor = rs.history[0].rv
+		rs.history = rs.history[1:]
+	}
+}
+
+// initialEventsWatch prepends a fixed burst of events (either a full
+// snapshot replayed as ADDED events, or exactly what a resuming watcher
+// missed, see REST.Watch) to a live watch.Interface, so a new watcher
+// observes that burst before any subsequent live transitions.
+type initialEventsWatch struct {
+	result chan watch.Event
+	source watch.Interface
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newInitialEventsWatch(initial []watch.Event, source watch.Interface) watch.Interface {
+	w := &initialEventsWatch{
+		result: make(chan watch.Event),
+		source: source,
+		done:   make(chan struct{}),
+	}
+	go w.run(initial)
+	return w
+}
+
+func (w *initialEventsWatch) run(initial []watch.Event) {
+	defer close(w.result)
+
+	for i := range initial {
+		select {
+		case w.result <- initial[i]:
+		case <-w.done:
+			return
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-w.source.ResultChan():
+			if !ok {
+				return
+			}
+			select {
+			case w.result <- event:
+			case <-w.done:
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *initialEventsWatch) Stop() {
+	w.source.Stop()
+	w.once.Do(func() { close(w.done) })
+}
+
+func (w *initialEventsWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}